@@ -0,0 +1,326 @@
+// Copyright 2019 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/neermitt/alertmanager-ha/provider/kvstore"
+)
+
+var (
+	ErrorConsulNotInitialized     = errors.New("Consul not initialized")
+	ErrorConsulGetNoResult        = errors.New("consulGet did not receive a result for fingerprint")
+	ErrorConsulGetMultipleResults = errors.New("consulGet received multiple results for fingerprint")
+
+	// Prometheus Counters
+	consulCheckAndPutTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_consul_checkandput_total",
+			Help: "The total number of CheckAndPut calls received",
+		},
+		[]string{"status"},
+	) // "status":"filtered|accepted"
+	consulOperationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_consul_operations_total",
+			Help: "The total number of operations initiated to consul",
+		},
+		[]string{"operation", "result"},
+	) // "operation": "get|put|del", "result":"success|error|notfound"
+	consulWatchOperationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alertmanager_consul_watch_operations_total",
+			Help: "The total number of operations received from consul long-poll watches",
+		},
+		[]string{"operation"},
+	) // "operation":"put"
+)
+
+const ConsulTimeoutGet = 150 * time.Millisecond
+const ConsulTimeoutPut = 250 * time.Millisecond
+const ConsulWatchTimeout = 5 * time.Minute
+const ConsulRetryGetFailure = 5 * time.Second
+
+// ConsulClient is the Consul-backed kvstore.Provider implementation. It
+// replicates alert state the same way EtcdClient does, except that change
+// notification is done with Consul's blocking `?index=` KV queries instead
+// of etcd's native watch API.
+var _ kvstore.Provider = (*ConsulClient)(nil)
+
+// Config holds the consul-specific settings needed to construct a
+// ConsulClient.
+type Config struct {
+	Addresses []string
+	Prefix    string
+
+	// Codec selects the wire format new values are written with. Left zero-
+	// valued, it defaults to the legacy unprefixed JSON format for a safe
+	// rolling upgrade; set it to kvstore.CodecJSON or another CodecKind to
+	// opt in to magic-prefixed values.
+	Codec kvstore.CodecKind
+}
+
+type ConsulClient struct {
+	alerts kvstore.AlertSink
+	prefix string
+	logger log.Logger
+	client *api.Client
+	codec  kvstore.Codec
+	mtx    sync.Mutex
+}
+
+func NewConsulClient(ctx context.Context, alerts kvstore.AlertSink, logger log.Logger, cfg Config) (*ConsulClient, error) {
+	codec, err := kvstore.NewCodec(cfg.Codec)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := &ConsulClient{
+		alerts: alerts,
+		prefix: cfg.Prefix,
+		logger: log.With(logger, "component", "provider.consul"),
+		codec:  codec,
+	}
+
+	// Consul's API client only takes a single address, so only the first of
+	// cfg.Addresses is used; the other addresses are ignored.
+	config := api.DefaultConfig()
+	if len(cfg.Addresses) > 0 {
+		config.Address = cfg.Addresses[0]
+	}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		level.Error(cc.logger).Log("msg", "Consul connection failed", "err", err)
+		return nil, err
+	}
+	level.Info(cc.logger).Log("msg", "Consul connection successful")
+
+	cc.mtx.Lock()
+	cc.client = client
+	cc.mtx.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		level.Info(cc.logger).Log("msg", "Consul connection shut down")
+	}()
+
+	return cc, nil
+}
+
+func (cc *ConsulClient) CheckAndPut(oldAlert *types.Alert, alert *types.Alert) error {
+	// Reduce writes to Consul.  Only put to Consul if the current alert is
+	// "different" enough than the same alert in memory, as denoted by
+	// kvstore.ShouldWriteAlert.
+	if !kvstore.ShouldWriteAlert(oldAlert, alert) {
+		consulCheckAndPutTotal.With(prometheus.Labels{"status": "filtered"}).Inc()
+		return nil // skip write to consul
+	}
+
+	consulCheckAndPutTotal.With(prometheus.Labels{"status": "accepted"}).Inc()
+	return cc.Put(alert)
+}
+
+func (cc *ConsulClient) Get(fp model.Fingerprint) (*types.Alert, error) {
+	// We do a best effort.  If consul is not initialized yet, then skip
+	if cc.client == nil {
+		level.Error(cc.logger).Log("msg", "Not getting alert from consul, consul not initialized yet")
+		return nil, ErrorConsulNotInitialized
+	}
+
+	getCtx, cancel := context.WithTimeout(context.Background(), ConsulTimeoutGet)
+	defer cancel()
+
+	cc.mtx.Lock()
+	kv, _, err := cc.client.KV().Get(cc.prefix+fp.String(), (&api.QueryOptions{}).WithContext(getCtx))
+	cc.mtx.Unlock()
+	if err != nil {
+		level.Error(cc.logger).Log("msg", "Error getting alert from consul", "err", err)
+		consulOperationsTotal.With(prometheus.Labels{"operation": "get", "result": "error"}).Inc()
+		return nil, err
+	}
+
+	if kv == nil {
+		consulOperationsTotal.With(prometheus.Labels{"operation": "get", "result": "notfound"}).Inc()
+		return nil, ErrorConsulGetNoResult
+	}
+
+	alert, err := kvstore.UnmarshalAlert(string(kv.Value))
+	if err != nil {
+		level.Error(cc.logger).Log("msg", "Error unmarshaling JSON Alert", "err", err)
+		consulOperationsTotal.With(prometheus.Labels{"operation": "get", "result": "error"}).Inc()
+		return nil, err
+	}
+
+	consulOperationsTotal.With(prometheus.Labels{"operation": "get", "result": "success"}).Inc()
+	return alert, nil
+}
+
+func (cc *ConsulClient) Put(alert *types.Alert) error {
+	// We do a best effort.  If consul is not initialized yet, then skip
+	if cc.client == nil {
+		level.Error(cc.logger).Log("msg", "Not putting alert to consul, consul not initialized yet")
+		return ErrorConsulNotInitialized
+	}
+
+	fp := alert.Fingerprint()
+	alertStr, err := cc.codec.Marshal(alert)
+	if err != nil {
+		level.Error(cc.logger).Log("msg", "Error marshaling JSON Alert", "err", err)
+		consulOperationsTotal.With(prometheus.Labels{"operation": "put", "result": "error"}).Inc()
+		return err
+	}
+
+	putCtx, cancel := context.WithTimeout(context.Background(), ConsulTimeoutPut)
+	defer cancel()
+
+	cc.mtx.Lock()
+	_, err = cc.client.KV().Put(&api.KVPair{
+		Key:   cc.prefix + fp.String(),
+		Value: []byte(alertStr),
+	}, (&api.WriteOptions{}).WithContext(putCtx))
+	cc.mtx.Unlock()
+	if err != nil {
+		level.Error(cc.logger).Log("msg", "Error putting alert to consul", "err", err)
+		consulOperationsTotal.With(prometheus.Labels{"operation": "put", "result": "error"}).Inc()
+		return err
+	}
+
+	consulOperationsTotal.With(prometheus.Labels{"operation": "put", "result": "success"}).Inc()
+	return nil
+}
+
+func (cc *ConsulClient) Del(fp model.Fingerprint) error {
+	// We do a best effort.  If consul is not initialized yet, then skip
+	if cc.client == nil {
+		level.Error(cc.logger).Log("msg", "Not deleting alert from consul, consul not initialized yet")
+		return ErrorConsulNotInitialized
+	}
+
+	delCtx, cancel := context.WithTimeout(context.Background(), ConsulTimeoutPut)
+	defer cancel()
+
+	cc.mtx.Lock()
+	_, err := cc.client.KV().Delete(cc.prefix+fp.String(), (&api.WriteOptions{}).WithContext(delCtx))
+	cc.mtx.Unlock()
+	if err != nil {
+		consulOperationsTotal.With(prometheus.Labels{"operation": "del", "result": "error"}).Inc()
+		return err
+	}
+	consulOperationsTotal.With(prometheus.Labels{"operation": "del", "result": "success"}).Inc()
+	return nil
+}
+
+// Watch long-polls the prefix for changes made by other cluster peers and
+// writes them back to our local alert state, mirroring EtcdClient.Watch.
+func (cc *ConsulClient) Watch(ctx context.Context) {
+	go func() {
+		level.Info(cc.logger).Log("msg", "Consul Watch Started")
+		var lastIndex uint64
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			// cc.client is never reassigned after construction, so the lock
+			// only needs to protect the pointer read, not the blocking
+			// long-poll itself; holding it across a up-to-5-minute List call
+			// would stall every foreground Get/Put/Del on the same client.
+			cc.mtx.Lock()
+			client := cc.client
+			cc.mtx.Unlock()
+
+			kvs, meta, err := client.KV().List(cc.prefix, (&api.QueryOptions{
+				WaitIndex: lastIndex,
+				WaitTime:  ConsulWatchTimeout,
+			}).WithContext(ctx))
+			if err != nil {
+				level.Error(cc.logger).Log("msg", "Error watching consul prefix", "err", err)
+				time.Sleep(ConsulRetryGetFailure)
+				continue
+			}
+
+			if meta.LastIndex == lastIndex {
+				// Long-poll timed out with no change; re-poll from the same index.
+				continue
+			}
+			lastIndex = meta.LastIndex
+
+			for _, kv := range kvs {
+				level.Debug(cc.logger).Log("msg", "watch received",
+					"key", fmt.Sprintf("%q", kv.Key), "value", fmt.Sprintf("%q", kv.Value))
+				consulWatchOperationsTotal.With(prometheus.Labels{"operation": "put"}).Inc()
+				alert, err := kvstore.UnmarshalAlert(string(kv.Value))
+				if err != nil {
+					continue
+				}
+				if len(alert.Labels) == 0 {
+					level.Warn(cc.logger).Log("msg", "Watch received Unmarshalled alert with empty LabelSet")
+					continue
+				}
+				_ = cc.alerts.PutFromEtcd(alert) // best effort only
+			}
+		}
+	}()
+}
+
+// LoadAll loads every alert currently under prefix into local memory. It is
+// called once at startup to seed this instance's state from its peers.
+func (cc *ConsulClient) LoadAll(ctx context.Context) {
+	go func() {
+		level.Info(cc.logger).Log("msg", "Consul Load All Alerts Started")
+		count := 0
+		for {
+			cc.mtx.Lock()
+			kvs, _, err := cc.client.KV().List(cc.prefix, (&api.QueryOptions{}).WithContext(ctx))
+			cc.mtx.Unlock()
+			if err != nil {
+				level.Error(cc.logger).Log("msg", "Error fetching all alerts from consul", "err", err)
+				time.Sleep(ConsulRetryGetFailure)
+				continue // retry
+			}
+
+			for _, kv := range kvs {
+				level.Debug(cc.logger).Log("msg", "get received",
+					"key", fmt.Sprintf("%q", kv.Key), "value", fmt.Sprintf("%q", kv.Value))
+				alert, err := kvstore.UnmarshalAlert(string(kv.Value))
+				if err != nil {
+					continue // skip values that cannot be decoded
+				}
+				count += 1
+				_ = cc.alerts.PutFromEtcd(alert) // best effort only
+			}
+			level.Info(cc.logger).Log("msg", "Consul Load All Alerts Finished", "count", count)
+			return // we only need to load all of the alerts once
+		}
+	}()
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	etcdBatchSize = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "alertmanager_etcd_batch_size",
+			Help:    "The number of alerts committed per etcd batch Txn",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 8), // 1..128
+		},
+	)
+	etcdBatchFlushDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "alertmanager_etcd_batch_flush_duration_seconds",
+			Help:    "Time taken to commit a single etcd batch Txn",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+)
+
+// DefaultBatchMaxSize is the largest number of alerts committed in a single
+// etcd Txn. etcd rejects transactions with more operations than its
+// max-txn-ops limit (128 by default), so larger batches are chunked to this
+// size instead of being rejected outright.
+const DefaultBatchMaxSize = 128
+
+// DefaultBatchFlushInterval is how often the coalescing write queue is
+// flushed to etcd.
+const DefaultBatchFlushInterval = 100 * time.Millisecond
+
+// enqueue adds alert to the coalescing write queue, replacing any
+// not-yet-flushed alert already queued for the same fingerprint. An alert
+// that flaps several times within a single flush window is therefore
+// written to etcd only once, with its latest value.
+func (ec *EtcdClient) enqueue(alert *types.Alert) {
+	ec.queueMtx.Lock()
+	ec.queue[alert.Fingerprint()] = alert
+	ec.queueMtx.Unlock()
+}
+
+// runBatchFlush drains and commits the coalescing write queue every
+// batchFlushInterval, until ctx is done, at which point it flushes once more
+// so alerts coalesced since the last tick aren't dropped on shutdown.
+func (ec *EtcdClient) runBatchFlush(ctx context.Context) {
+	ticker := time.NewTicker(ec.batchFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is already done, so derive the final flush's Txn timeout
+			// from a fresh context rather than one that would cancel it
+			// immediately.
+			ec.flushQueue(context.Background())
+			return
+		case <-ticker.C:
+			ec.flushQueue(ctx)
+		}
+	}
+}
+
+// flushQueue drains the coalescing write queue and commits it to etcd,
+// chunked to at most batchMaxSize alerts per Txn.
+func (ec *EtcdClient) flushQueue(ctx context.Context) {
+	ec.queueMtx.Lock()
+	if len(ec.queue) == 0 {
+		ec.queueMtx.Unlock()
+		return
+	}
+	alerts := make([]*types.Alert, 0, len(ec.queue))
+	for _, alert := range ec.queue {
+		alerts = append(alerts, alert)
+	}
+	ec.queue = map[model.Fingerprint]*types.Alert{}
+	ec.queueMtx.Unlock()
+
+	for len(alerts) > 0 {
+		n := ec.batchMaxSize
+		if n > len(alerts) {
+			n = len(alerts)
+		}
+		ec.commitBatch(ctx, alerts[:n])
+		alerts = alerts[n:]
+	}
+}
+
+// leaseForBatch returns the lease already being kept alive for fp, if any,
+// so a batched write can reuse it without an extra Grant RPC; a fingerprint
+// with no lease yet (new to the store) falls back to grantLease.
+func (ec *EtcdClient) leaseForBatch(ctx context.Context, fp model.Fingerprint, alert *types.Alert) (clientv3.LeaseID, error) {
+	ec.leasesMtx.Lock()
+	handle, ok := ec.leases[fp]
+	ec.leasesMtx.Unlock()
+	if ok {
+		return handle.id, nil
+	}
+	return ec.grantLease(ctx, fp, alert)
+}
+
+// commitBatch writes a single chunk of alerts to etcd as one Txn. Each alert
+// carries a lease exactly as Put does, but reuses its existing
+// already-kept-alive lease when it has one instead of granting a new one, so
+// a batch of already-active alerts costs one Txn RPC and nothing more.
+func (ec *EtcdClient) commitBatch(ctx context.Context, alerts []*types.Alert) {
+	commitCtx, cancel := context.WithTimeout(ctx, EtcdTimeoutPut)
+	defer cancel()
+
+	ops := make([]clientv3.Op, 0, len(alerts))
+	for _, alert := range alerts {
+		fp := alert.Fingerprint()
+		alertStr, err := ec.codec.Marshal(alert)
+		if err != nil {
+			level.Error(ec.logger).Log("msg", "Error marshaling alert for etcd batch", "err", err)
+			etcdOperationsTotal.With(prometheus.Labels{"operation": "put", "result": "error"}).Inc()
+			continue
+		}
+
+		leaseID, err := ec.leaseForBatch(commitCtx, fp, alert)
+		if err != nil {
+			level.Error(ec.logger).Log("msg", "Error granting etcd lease for batch", "err", err)
+			etcdOperationsTotal.With(prometheus.Labels{"operation": "put", "result": "error"}).Inc()
+			continue
+		}
+
+		ops = append(ops, clientv3.OpPut(alertKeyPrefix+fp.String(), alertStr, clientv3.WithLease(leaseID)))
+	}
+	if len(ops) == 0 {
+		return
+	}
+
+	start := time.Now()
+	ec.mtx.Lock()
+	_, err := ec.client.Txn(commitCtx).Then(ops...).Commit()
+	ec.mtx.Unlock()
+
+	etcdBatchSize.Observe(float64(len(ops)))
+	etcdBatchFlushDuration.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		level.Error(ec.logger).Log("msg", "Error committing etcd batch", "err", err, "size", len(ops))
+		etcdOperationsTotal.With(prometheus.Labels{"operation": "put", "result": "error"}).Inc()
+		return
+	}
+	etcdOperationsTotal.With(prometheus.Labels{"operation": "put", "result": "success"}).Add(float64(len(ops)))
+}
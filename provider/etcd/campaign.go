@@ -0,0 +1,148 @@
+// Copyright 2019 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.etcd.io/etcd/clientv3/concurrency"
+
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	etcdIsLeader = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "alertmanager_etcd_is_leader",
+			Help: "Whether this instance currently holds the etcd campaign (1) or not (0)",
+		},
+	)
+	etcdLeaderElectionsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "alertmanager_etcd_leader_elections_total",
+			Help: "The total number of times this instance was elected etcd campaign leader",
+		},
+	)
+)
+
+// campaignElectionKey is the election key used under the client's namespace
+// (see NewEtcdClient), kept distinct from alert keys stored alongside it.
+const campaignElectionKey = "_campaign"
+
+// Campaign continuously campaigns for cluster-wide leadership using
+// go.etcd.io/etcd/clientv3/concurrency, so singleton maintenance jobs (e.g. a
+// future janitor pruning alert keys whose fingerprints no longer resolve in
+// memory on any peer, or running LoadAll exactly once after a cluster-wide
+// restart) can gate on IsLeader instead of every replica doing the work
+// independently and stampeding etcd.
+func (ec *EtcdClient) Campaign(ctx context.Context) {
+	go ec.runCampaign(ctx)
+}
+
+func (ec *EtcdClient) runCampaign(ctx context.Context) {
+	candidate, err := os.Hostname()
+	if err != nil {
+		candidate = fmt.Sprintf("unknown-%d", time.Now().UnixNano())
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		ec.mtx.Lock()
+		client := ec.client
+		ec.mtx.Unlock()
+		if client == nil {
+			// The client was torn down (ctx is done, or about to be);
+			// nothing left to campaign with.
+			return
+		}
+
+		session, err := concurrency.NewSession(client, concurrency.WithContext(ctx))
+		if err != nil {
+			level.Error(ec.logger).Log("msg", "Error creating etcd campaign session", "err", err)
+			time.Sleep(EtcdRetryGetFailure)
+			continue
+		}
+
+		election := concurrency.NewElection(session, campaignElectionKey)
+		level.Info(ec.logger).Log("msg", "Campaigning for etcd leadership", "candidate", candidate)
+		if err := election.Campaign(ctx, candidate); err != nil {
+			level.Error(ec.logger).Log("msg", "Error campaigning for etcd leadership", "err", err)
+			_ = session.Close()
+			continue
+		}
+
+		etcdLeaderElectionsTotal.Inc()
+		ec.setLeader(true)
+		level.Info(ec.logger).Log("msg", "Became etcd leader", "candidate", candidate)
+
+		select {
+		case <-ctx.Done():
+			ec.setLeader(false)
+			_ = session.Close()
+			return
+		case <-session.Done():
+			ec.setLeader(false)
+			level.Warn(ec.logger).Log("msg", "Lost etcd leadership, campaign session expired")
+		}
+	}
+}
+
+func (ec *EtcdClient) setLeader(isLeader bool) {
+	ec.leaderMtx.Lock()
+	changed := ec.isLeader != isLeader
+	ec.isLeader = isLeader
+	ec.leaderMtx.Unlock()
+
+	if isLeader {
+		etcdIsLeader.Set(1)
+	} else {
+		etcdIsLeader.Set(0)
+	}
+
+	if !changed {
+		return
+	}
+	select {
+	case ec.leaderChanged <- isLeader:
+	default:
+		// Nobody is listening right now; drop rather than block the
+		// campaign loop on a slow or absent consumer.
+	}
+}
+
+// IsLeader reports whether this instance currently holds the campaign.
+func (ec *EtcdClient) IsLeader() bool {
+	ec.leaderMtx.Lock()
+	defer ec.leaderMtx.Unlock()
+	return ec.isLeader
+}
+
+// LeaderChanged receives true when this instance becomes the campaign
+// leader and false when it loses leadership. The channel holds one value; a
+// change made while the previous one is still unread is dropped.
+func (ec *EtcdClient) LeaderChanged() <-chan bool {
+	return ec.leaderChanged
+}
@@ -15,15 +15,16 @@ package etcd
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"os"
-	"reflect"
 	"sync"
 	"time"
 
 	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/clientv3/namespace"
+	"go.etcd.io/etcd/pkg/transport"
 	"google.golang.org/grpc"
 
 	"github.com/go-kit/kit/log"
@@ -33,6 +34,8 @@ import (
 	"github.com/prometheus/alertmanager/types"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/neermitt/alertmanager-ha/provider/kvstore"
 )
 
 var (
@@ -69,6 +72,24 @@ var (
 		},
 		[]string{"name"},
 	)
+	etcdLeasesActive = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "alertmanager_etcd_leases_active",
+			Help: "The number of etcd leases currently being kept alive for in-memory alerts",
+		},
+	)
+	etcdLeaseExpiredTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "alertmanager_etcd_lease_expired_total",
+			Help: "The total number of etcd leases that expired instead of being revoked",
+		},
+	)
+	etcdWatchHealthy = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "alertmanager_etcd_watch_healthy",
+			Help: "Whether the etcd watch is healthy (1) or was torn down after consecutive failed health probes (0)",
+		},
+	)
 )
 
 const EtcdTimeoutGet = 150 * time.Millisecond
@@ -77,30 +98,212 @@ const EtcdDelayRunWatch = 10 * time.Second
 const EtcdDelayRunLoad = 15 * time.Second
 const EtcdRetryGetFailure = 5 * time.Second
 
+// EtcdWatchHealthCheckInterval is how often the watch loop probes etcd on
+// a sentinel key to make sure the watch stream is still alive.
+const EtcdWatchHealthCheckInterval = 10 * time.Second
+
+// EtcdWatchHealthCheckTimeout bounds a single health probe.
+const EtcdWatchHealthCheckTimeout = 2 * time.Second
+
+// EtcdWatchMaxConsecutiveFailures is the number of consecutive health probe
+// failures that causes the watch loop to tear down and recreate the watch.
+const EtcdWatchMaxConsecutiveFailures = 3
+
+// etcdWatchHealthSentinelKey is appended to the client's prefix for health
+// probes; it is never expected to hold a real alert.
+const etcdWatchHealthSentinelKey = "__watch_health__"
+
+// alertKeyPrefix scopes alert keys to their own sub-prefix within the
+// client's namespace, distinct from control keys like campaignElectionKey
+// (see campaign.go). Without this, Watch/LoadAll's prefix would cover the
+// whole namespace and every election write would flow into the alert watch
+// loop, get counted as a watch operation, and be discarded only after a
+// wasted UnmarshalAlert attempt.
+const alertKeyPrefix = "alerts/"
+
+// DefaultLeaseTTLMargin is the buffer added on top of an alert's remaining
+// lifetime (EndsAt + ResolveTimeout) when sizing its etcd lease, absorbing
+// clock skew and the gap between an alert resolving and being deleted.
+const DefaultLeaseTTLMargin = 60 * time.Second
+
+// DefaultLeaseKeepAliveInterval is how often an active lease is refreshed.
+const DefaultLeaseKeepAliveInterval = 10 * time.Second
+
+// minLeaseTTLFactor is the smallest TTL we ever request, expressed as a
+// multiple of leaseKeepAliveInterval: after its initial refresh,
+// keepAliveLease only refreshes once every full interval, so a TTL any
+// shorter than that risks the lease expiring in etcd between two refreshes.
+// The extra factor of 2 leaves room for a missed or slow tick.
+const minLeaseTTLFactor = 2
+
+// EtcdClient is the etcd-backed kvstore.Provider implementation.
+var _ kvstore.Provider = (*EtcdClient)(nil)
+
+// Config holds the etcd-specific settings needed to construct an EtcdClient.
+type Config struct {
+	Endpoints []string
+	Prefix    string
+
+	// TLS configures mutual TLS to the etcd cluster. Left zero-valued, the
+	// connection is plaintext.
+	TLS TLSConfig
+	// Username and Password authenticate against etcd's built-in auth, if
+	// the cluster has it enabled. Password is expected to already be read
+	// from --cluster.etcd.password-file by the caller.
+	Username string
+	Password string
+
+	// ResolveTimeout is Alertmanager's configured resolve_timeout; it is
+	// added to an alert's EndsAt when sizing that alert's etcd lease, since
+	// the alert is expected to stay "active" in memory for that long after
+	// resolving.
+	ResolveTimeout time.Duration
+	// LeaseTTLMargin is added on top of EndsAt+ResolveTimeout as a buffer.
+	// Defaults to DefaultLeaseTTLMargin.
+	LeaseTTLMargin time.Duration
+	// LeaseKeepAliveInterval is how often active leases are refreshed.
+	// Defaults to DefaultLeaseKeepAliveInterval.
+	LeaseKeepAliveInterval time.Duration
+
+	// Codec selects the wire format new values are written with. Left zero-
+	// valued, it defaults to the legacy unprefixed JSON format for a safe
+	// rolling upgrade; set it to kvstore.CodecJSON or another CodecKind to
+	// opt in to magic-prefixed values.
+	Codec kvstore.CodecKind
+
+	// BatchMaxSize is the largest number of alerts committed in a single
+	// etcd Txn. Defaults to DefaultBatchMaxSize.
+	BatchMaxSize int
+	// BatchFlushInterval is how often the coalescing write queue is
+	// flushed to etcd. Defaults to DefaultBatchFlushInterval.
+	BatchFlushInterval time.Duration
+}
+
+// TLSConfig holds the etcd client's mutual TLS settings, sourced from
+// --cluster.etcd.tls.ca-file, --cluster.etcd.tls.cert-file and
+// --cluster.etcd.tls.key-file. A zero-valued TLSConfig disables TLS.
+type TLSConfig struct {
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+}
+
+// buildTLSConfig returns the *tls.Config to dial etcd with, or nil if cfg is
+// unset, in which case the connection is plaintext.
+func buildTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	if cfg.CAFile == "" && cfg.CertFile == "" && cfg.KeyFile == "" {
+		return nil, nil
+	}
+
+	info := transport.TLSInfo{
+		CertFile:      cfg.CertFile,
+		KeyFile:       cfg.KeyFile,
+		TrustedCAFile: cfg.CAFile,
+		ServerName:    cfg.ServerName,
+	}
+	return info.ClientConfig()
+}
+
+type leaseHandle struct {
+	id     clientv3.LeaseID
+	cancel context.CancelFunc
+}
+
 type EtcdClient struct {
-	alerts    *Alerts
+	alerts    kvstore.AlertSink
 	endpoints []string
 	prefix    string
 	logger    log.Logger
 	client    *clientv3.Client
 	mtx       sync.Mutex
+	codec     kvstore.Codec
+
+	// rootCtx is the ctx NewEtcdClient was constructed with. Per-alert
+	// keep-alive goroutines derive their own cancellation from it so they
+	// are torn down alongside the client instead of outliving it.
+	rootCtx context.Context
+
+	resolveTimeout         time.Duration
+	leaseTTLMargin         time.Duration
+	leaseKeepAliveInterval time.Duration
+	leases                 map[model.Fingerprint]leaseHandle
+	leasesMtx              sync.Mutex
+
+	lastHealthyTime time.Time
+	healthMtx       sync.Mutex
+
+	isLeader      bool
+	leaderMtx     sync.Mutex
+	leaderChanged chan bool
+
+	batchMaxSize       int
+	batchFlushInterval time.Duration
+	queue              map[model.Fingerprint]*types.Alert
+	queueMtx           sync.Mutex
+
+	// loadOnce guards the initial LoadAll so it runs exactly once no matter
+	// whether it's triggered by an explicit LoadAll call, by Watch needing a
+	// starting revision, or both: whichever runs first, the other waits for
+	// and reuses its result instead of loading everything a second time.
+	loadOnce sync.Once
+	loadRev  int64
+	loadErr  error
 }
 
-func NewEtcdClient(ctx context.Context, a *Alerts, endpoints []string, prefix string) (*EtcdClient, error) {
+func NewEtcdClient(ctx context.Context, alerts kvstore.AlertSink, logger log.Logger, cfg Config) (*EtcdClient, error) {
+	leaseTTLMargin := cfg.LeaseTTLMargin
+	if leaseTTLMargin <= 0 {
+		leaseTTLMargin = DefaultLeaseTTLMargin
+	}
+	leaseKeepAliveInterval := cfg.LeaseKeepAliveInterval
+	if leaseKeepAliveInterval <= 0 {
+		leaseKeepAliveInterval = DefaultLeaseKeepAliveInterval
+	}
+	batchMaxSize := cfg.BatchMaxSize
+	if batchMaxSize <= 0 {
+		batchMaxSize = DefaultBatchMaxSize
+	}
+	batchFlushInterval := cfg.BatchFlushInterval
+	if batchFlushInterval <= 0 {
+		batchFlushInterval = DefaultBatchFlushInterval
+	}
+	codec, err := kvstore.NewCodec(cfg.Codec)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := buildTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
 
 	ec := &EtcdClient{
-		alerts:    a,
-		endpoints: endpoints,
-		prefix:    prefix,
-		logger:    log.With(a.logger, "component", "provider.etcd"),
+		alerts:                 alerts,
+		endpoints:              cfg.Endpoints,
+		prefix:                 cfg.Prefix,
+		logger:                 log.With(logger, "component", "provider.etcd"),
+		rootCtx:                ctx,
+		codec:                  codec,
+		resolveTimeout:         cfg.ResolveTimeout,
+		leaseTTLMargin:         leaseTTLMargin,
+		leaseKeepAliveInterval: leaseKeepAliveInterval,
+		leases:                 map[model.Fingerprint]leaseHandle{},
+		leaderChanged:          make(chan bool, 1),
+		batchMaxSize:           batchMaxSize,
+		batchFlushInterval:     batchFlushInterval,
+		queue:                  map[model.Fingerprint]*types.Alert{},
 	}
 
 	// create the configuration
 	etcdConfig := clientv3.Config{
-		Endpoints:        endpoints,
+		Endpoints:        cfg.Endpoints,
 		AutoSyncInterval: 60 * time.Second,
 		DialTimeout:      10 * time.Second,
 		DialOptions:      []grpc.DialOption{grpc.WithBlock()}, // block until connect
+		TLS:              tlsConfig,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
 	}
 
 	// create the client
@@ -115,6 +318,18 @@ func NewEtcdClient(ctx context.Context, a *Alerts, endpoints []string, prefix st
 	} else {
 		level.Info(ec.logger).Log("msg", "Etcd connection successful")
 	}
+
+	// Namespace the client to cfg.Prefix so every KV/Watcher/Lease call below
+	// operates on unprefixed keys; this replaces hand-concatenating
+	// ec.prefix onto every key, which both keeps key arithmetic out of
+	// Get/Put/Del/Watch and scopes concurrency.NewSession's election and
+	// lease keys (in campaign.go) under the same prefix for free.
+	if cfg.Prefix != "" {
+		client.KV = namespace.NewKV(client.KV, cfg.Prefix)
+		client.Watcher = namespace.NewWatcher(client.Watcher, cfg.Prefix)
+		client.Lease = namespace.NewLease(client.Lease, cfg.Prefix)
+	}
+
 	ec.mtx.Lock()
 	ec.client = client
 	ec.mtx.Unlock()
@@ -134,20 +349,26 @@ func NewEtcdClient(ctx context.Context, a *Alerts, endpoints []string, prefix st
 		for range ctx.Done() {
 		}
 	}()
+
+	go ec.runBatchFlush(ctx)
+
 	return ec, nil
 }
 
+// CheckAndPut reduces writes to etcd by only queueing the alert if it is
+// "different" enough from the same alert in memory, as denoted by
+// kvstore.ShouldWriteAlert. Queued alerts are coalesced by fingerprint
+// (latest write wins) and committed to etcd in batches by runBatchFlush,
+// rather than issuing one Put RPC per alert.
 func (ec *EtcdClient) CheckAndPut(oldAlert *types.Alert, alert *types.Alert) error {
-	// Reduce writes to Etcd.  Only put to Etcd if the current alert is
-	// "different" enough than the same alert in memory, as denoted by the
-	// AlertsShouldWriteToEtcd function.
-	if !AlertsShouldWriteToEtcd(oldAlert, alert) {
+	if !kvstore.ShouldWriteAlert(oldAlert, alert) {
 		etcdCheckAndPutTotal.With(prometheus.Labels{"status": "filtered"}).Inc()
 		return nil // skip write to etcd
 	}
 
 	etcdCheckAndPutTotal.With(prometheus.Labels{"status": "accepted"}).Inc()
-	return ec.Put(alert)
+	ec.enqueue(alert)
+	return nil
 }
 
 func (ec *EtcdClient) Get(fp model.Fingerprint) (*types.Alert, error) {
@@ -162,7 +383,7 @@ func (ec *EtcdClient) Get(fp model.Fingerprint) (*types.Alert, error) {
 	defer cancel()
 
 	ec.mtx.Lock()
-	resp, err := ec.client.Get(ctx, ec.prefix+fp.String())
+	resp, err := ec.client.Get(ctx, alertKeyPrefix+fp.String())
 	ec.mtx.Unlock()
 	if err != nil {
 		level.Error(ec.logger).Log("msg", "Error getting alert from etcd", "err", err)
@@ -178,7 +399,7 @@ func (ec *EtcdClient) Get(fp model.Fingerprint) (*types.Alert, error) {
 		return nil, ErrorEtcdGetMultipleResults
 	}
 
-	alert, err := UnmarshalAlert(string(resp.Kvs[0].Value))
+	alert, err := kvstore.UnmarshalAlert(string(resp.Kvs[0].Value))
 	if err != nil {
 		level.Error(ec.logger).Log("msg", "Error unmarshaling JSON Alert", "err", err)
 		etcdOperationsTotal.With(prometheus.Labels{"operation": "get", "result": "error"}).Inc()
@@ -197,7 +418,7 @@ func (ec *EtcdClient) Put(alert *types.Alert) error {
 	}
 
 	fp := alert.Fingerprint()
-	alertStr, err := MarshalAlert(alert)
+	alertStr, err := ec.codec.Marshal(alert)
 	if err != nil {
 		level.Error(ec.logger).Log("msg", "Error marshaling JSON Alert", "err", err)
 		etcdOperationsTotal.With(prometheus.Labels{"operation": "put", "result": "error"}).Inc()
@@ -208,8 +429,15 @@ func (ec *EtcdClient) Put(alert *types.Alert) error {
 	ctx, cancel := context.WithTimeout(context.Background(), EtcdTimeoutPut)
 	defer cancel()
 
+	leaseID, err := ec.grantLease(ctx, fp, alert)
+	if err != nil {
+		level.Error(ec.logger).Log("msg", "Error granting etcd lease", "err", err)
+		etcdOperationsTotal.With(prometheus.Labels{"operation": "put", "result": "error"}).Inc()
+		return err
+	}
+
 	ec.mtx.Lock()
-	_, err = ec.client.Put(ctx, ec.prefix+fp.String(), alertStr)
+	_, err = ec.client.Put(ctx, alertKeyPrefix+fp.String(), alertStr, clientv3.WithLease(leaseID))
 	ec.mtx.Unlock()
 	if err != nil {
 		level.Error(ec.logger).Log("msg", "Error putting alert to etcd", "err", err)
@@ -221,6 +449,105 @@ func (ec *EtcdClient) Put(alert *types.Alert) error {
 	return nil
 }
 
+// grantLease grants a lease sized for alert's remaining lifetime, starts
+// keeping it alive in the background, and returns its ID. Any lease
+// previously held for fp is revoked first so we never leak keep-alive
+// goroutines across repeated Puts of the same alert.
+func (ec *EtcdClient) grantLease(ctx context.Context, fp model.Fingerprint, alert *types.Alert) (clientv3.LeaseID, error) {
+	ec.revokeLease(fp)
+
+	ttl := time.Until(alert.EndsAt) + ec.resolveTimeout + ec.leaseTTLMargin
+	if minTTL := minLeaseTTLFactor * ec.leaseKeepAliveInterval; ttl < minTTL {
+		ttl = minTTL
+	}
+
+	ec.mtx.Lock()
+	grant, err := ec.client.Grant(ctx, int64(ttl.Seconds()))
+	ec.mtx.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	keepAliveCtx, cancel := context.WithCancel(ec.rootCtx)
+	ec.leasesMtx.Lock()
+	ec.leases[fp] = leaseHandle{id: grant.ID, cancel: cancel}
+	ec.leasesMtx.Unlock()
+	etcdLeasesActive.Inc()
+
+	go ec.keepAliveLease(keepAliveCtx, fp, grant.ID)
+
+	return grant.ID, nil
+}
+
+// keepAliveLease periodically refreshes a lease, every
+// leaseKeepAliveInterval, until keepAliveCtx is cancelled (the lease was
+// revoked or replaced) or the refresh fails because the lease has already
+// expired in etcd. It refreshes once immediately on top of the ticker cadence
+// so a lease granted at (or near) the minLeaseTTLFactor floor is still
+// refreshed well within its TTL even if the first tick is delayed.
+func (ec *EtcdClient) keepAliveLease(keepAliveCtx context.Context, fp model.Fingerprint, id clientv3.LeaseID) {
+	ticker := time.NewTicker(ec.leaseKeepAliveInterval)
+	defer ticker.Stop()
+
+	ec.mtx.Lock()
+	_, err := ec.client.KeepAliveOnce(keepAliveCtx, id)
+	ec.mtx.Unlock()
+	if err != nil {
+		ec.expireLease(fp, id)
+		return
+	}
+
+	for {
+		select {
+		case <-keepAliveCtx.Done():
+			return
+		case <-ticker.C:
+			ec.mtx.Lock()
+			_, err := ec.client.KeepAliveOnce(keepAliveCtx, id)
+			ec.mtx.Unlock()
+			if err != nil {
+				ec.expireLease(fp, id)
+				return
+			}
+		}
+	}
+}
+
+// expireLease records that a lease was lost without ever being explicitly
+// revoked, i.e. it expired in etcd before we next refreshed it.
+func (ec *EtcdClient) expireLease(fp model.Fingerprint, id clientv3.LeaseID) {
+	ec.leasesMtx.Lock()
+	handle, ok := ec.leases[fp]
+	expired := ok && handle.id == id
+	if expired {
+		delete(ec.leases, fp)
+	}
+	ec.leasesMtx.Unlock()
+
+	if expired {
+		etcdLeasesActive.Dec()
+		etcdLeaseExpiredTotal.Inc()
+		level.Warn(ec.logger).Log("msg", "Etcd lease expired without being revoked", "fp", fp)
+	}
+}
+
+// revokeLease cancels the keep-alive goroutine for fp's current lease, if
+// any, so the lease is allowed to expire naturally in etcd rather than
+// being kept alive forever.
+func (ec *EtcdClient) revokeLease(fp model.Fingerprint) {
+	ec.leasesMtx.Lock()
+	handle, ok := ec.leases[fp]
+	if ok {
+		delete(ec.leases, fp)
+	}
+	ec.leasesMtx.Unlock()
+
+	if ok {
+		handle.cancel()
+		etcdLeasesActive.Dec()
+	}
+}
+
 func (ec *EtcdClient) Del(fp model.Fingerprint) error {
 	// We do a best effort.  If etcd is not initialized yet, then skip
 	if ec.client == nil {
@@ -228,12 +555,14 @@ func (ec *EtcdClient) Del(fp model.Fingerprint) error {
 		return ErrorEtcdNotInitialized
 	}
 
+	ec.revokeLease(fp)
+
 	// ensure the operation does not take too long
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 	defer cancel()
 
 	ec.mtx.Lock()
-	_, err := ec.client.Delete(ctx, ec.prefix+fp.String())
+	_, err := ec.client.Delete(ctx, alertKeyPrefix+fp.String())
 	ec.mtx.Unlock()
 	if err != nil {
 		etcdOperationsTotal.With(prometheus.Labels{"operation": "del", "result": "error"}).Inc()
@@ -243,122 +572,220 @@ func (ec *EtcdClient) Del(fp model.Fingerprint) error {
 	return nil
 }
 
-func (ec *EtcdClient) RunWatch(ctx context.Context) {
-	// watch for alert changes in etcd and writes them back to our
-	// local alert state
-	ctx = clientv3.WithRequireLeader(ctx)
+// Watch watches the store (namespaced to ec.prefix at the client level, see
+// NewEtcdClient) for alert changes and writes them back to our local alert
+// state. Unlike a single bare clientv3.Watch, it re-syncs from a fresh
+// LoadAll whenever the watched revision is compacted out from under it, and
+// it runs a health ticker alongside the watch so a dead TCP stream gets torn
+// down and recreated instead of silently wedging the loop.
+func (ec *EtcdClient) Watch(ctx context.Context) {
+	go ec.runWatch(ctx)
+}
+
+func (ec *EtcdClient) runWatch(ctx context.Context) {
+	// The very first load is shared with a concurrent/prior call to
+	// LoadAll via ensureLoaded, so a caller following the documented
+	// LoadAll-then-Watch sequence never pays for loading every alert
+	// twice at startup.
+	rev, err := ec.ensureLoaded(ctx)
+	if err != nil {
+		// ctx was cancelled while we were retrying the initial load.
+		return
+	}
 
-	go func() {
-		ec.mtx.Lock()
-		rch := ec.client.Watch(ctx, ec.prefix, clientv3.WithPrefix())
-		ec.mtx.Unlock()
-
-		level.Info(ec.logger).Log("msg", "Etcd Watch Started")
-		for wresp := range rch {
-			etcdQueueLength.With(prometheus.Labels{"name": "watch"}).Set(float64(len(rch)))
-
-			for _, ev := range wresp.Events {
-				level.Debug(ec.logger).Log("msg", "watch received",
-					"type", ev.Type, "key", fmt.Sprintf("%q", ev.Kv.Key), "value", fmt.Sprintf("%q", ev.Kv.Value))
-				if ev.Type.String() == "PUT" {
-					etcdWatchOperationsTotal.With(prometheus.Labels{"operation": "put"}).Inc()
-					alert, err := UnmarshalAlert(string(ev.Kv.Value))
-					if err != nil {
-						continue
-					}
-					if len(alert.Labels) == 0 {
-						// TODO: Saw this case happen.  Unsure if it was due to someone curling against AM.
-						//   For now, skip loading of this alert
-						level.Warn(ec.logger).Log("msg", "Watch received Unmarshalled alert with empty LabelSet")
-						continue
-					}
-					_ = ec.alerts.PutFromEtcd(alert) // best effort only
-				} else if ev.Type.String() == "DELETE" { // ignore DELETE operations
-					etcdWatchOperationsTotal.With(prometheus.Labels{"operation": "del"}).Inc()
-				} // else, ignore all other etcd operations, especially DELETE
-			}
+	for {
+		if ctxDone := ec.watchFrom(ctx, rev+1); ctxDone {
+			return
 		}
-	}()
+		// The watch ended early, either because the revision we asked for
+		// was compacted or because the health ticker decided the stream
+		// was wedged. Reload (this is a recovery reload, not the initial
+		// one, so it always runs fresh) to re-establish a known revision
+		// to watch from so we never silently miss events.
+		rev, err = ec.loadAllWithRetry(ctx)
+		if err != nil {
+			return
+		}
+	}
 }
 
-func (ec *EtcdClient) RunLoadAllAlerts(ctx context.Context) {
-	go func() {
-		level.Info(ec.logger).Log("msg", "Etcd Load All Alerts Started")
-		count := 0
-		for {
-			ec.mtx.Lock()
-			resp, err := ec.client.Get(ctx, ec.prefix, clientv3.WithPrefix())
-			ec.mtx.Unlock()
-			if err != nil {
-				level.Error(ec.logger).Log("msg", "Error fetching all alerts etcd", "err", err)
-				time.Sleep(EtcdRetryGetFailure)
-				continue // retry
+// watchFrom opens a watch on alertKeyPrefix starting at rev and applies
+// every event it receives to local alert state. It returns true
+// once ctx itself is done, and false whenever the watch ended for a reason
+// the caller should recover from (compaction, or the health ticker killing a
+// wedged stream) by reloading and re-watching.
+func (ec *EtcdClient) watchFrom(ctx context.Context, rev int64) bool {
+	watchCtx, cancelWatch := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancelWatch()
+
+	ec.mtx.Lock()
+	rch := ec.client.Watch(watchCtx, alertKeyPrefix, clientv3.WithPrefix(), clientv3.WithRev(rev))
+	ec.mtx.Unlock()
+
+	go ec.runWatchHealthCheck(watchCtx, cancelWatch)
+
+	level.Info(ec.logger).Log("msg", "Etcd Watch Started", "revision", rev)
+	for wresp := range rch {
+		if err := wresp.Err(); err != nil {
+			if wresp.CompactRevision != 0 {
+				level.Warn(ec.logger).Log("msg", "Etcd watch revision compacted, reloading",
+					"requestedRevision", rev, "compactRevision", wresp.CompactRevision)
+			} else {
+				level.Error(ec.logger).Log("msg", "Etcd watch error, reloading", "err", err)
 			}
+			return false
+		}
 
-			for _, ev := range resp.Kvs {
-				level.Debug(ec.logger).Log("msg", "get received",
-					"key", fmt.Sprintf("%q", ev.Key), "value", fmt.Sprintf("%q", ev.Value))
-				alert, err := UnmarshalAlert(string(ev.Value))
+		etcdQueueLength.With(prometheus.Labels{"name": "watch"}).Set(float64(len(rch)))
+
+		for _, ev := range wresp.Events {
+			level.Debug(ec.logger).Log("msg", "watch received",
+				"type", ev.Type, "key", fmt.Sprintf("%q", ev.Kv.Key), "value", fmt.Sprintf("%q", ev.Kv.Value))
+			if ev.Type.String() == "PUT" {
+				etcdWatchOperationsTotal.With(prometheus.Labels{"operation": "put"}).Inc()
+				alert, err := kvstore.UnmarshalAlert(string(ev.Kv.Value))
 				if err != nil {
-					continue // retry
+					continue
+				}
+				if len(alert.Labels) == 0 {
+					// TODO: Saw this case happen.  Unsure if it was due to someone curling against AM.
+					//   For now, skip loading of this alert
+					level.Warn(ec.logger).Log("msg", "Watch received Unmarshalled alert with empty LabelSet")
+					continue
 				}
-				count += 1
 				_ = ec.alerts.PutFromEtcd(alert) // best effort only
-			}
-			level.Info(ec.logger).Log("msg", "Etcd Load All Alerts Finished", "count", count)
-			return // we only need to load all of the alerts once
+			} else if ev.Type.String() == "DELETE" { // ignore DELETE operations
+				etcdWatchOperationsTotal.With(prometheus.Labels{"operation": "del"}).Inc()
+			} // else, ignore all other etcd operations, especially DELETE
 		}
-	}()
-}
-
-func AlertsShouldWriteToEtcd(a *types.Alert, o *types.Alert) bool {
-	// Check if the alerts are "different" enough.
-	// If alerts ARE "different" enough then return 'true' in order to write to Etcd
-	// If alerts are NOT "different" enough then return 'false' to skip writing to etcd
-
-	if a == nil || o == nil {
-		return true
-	}
-	if !reflect.DeepEqual(a.Labels, o.Labels) {
-		return true
-	}
-	if !reflect.DeepEqual(a.Annotations, o.Annotations) {
-		return true
 	}
-	if a.GeneratorURL != o.GeneratorURL {
+
+	// rch closed, either because we (or the health ticker) cancelled
+	// watchCtx, or because ctx itself is done.
+	select {
+	case <-ctx.Done():
 		return true
+	default:
+		return false
 	}
-	if !a.StartsAt.Equal(o.StartsAt) {
-		return true
+}
+
+// runWatchHealthCheck periodically probes etcd on a sentinel key while a
+// watch is open. After EtcdWatchMaxConsecutiveFailures in a row it cancels
+// cancelWatch so runWatch tears down and recreates the stream instead of
+// leaving it wedged against a dead TCP connection indefinitely.
+func (ec *EtcdClient) runWatchHealthCheck(watchCtx context.Context, cancelWatch context.CancelFunc) {
+	ticker := time.NewTicker(EtcdWatchHealthCheckInterval)
+	defer ticker.Stop()
+
+	consecutiveFailures := 0
+	for {
+		select {
+		case <-watchCtx.Done():
+			return
+		case <-ticker.C:
+			probeCtx, cancel := context.WithTimeout(watchCtx, EtcdWatchHealthCheckTimeout)
+			ec.mtx.Lock()
+			_, err := ec.client.Get(probeCtx, etcdWatchHealthSentinelKey)
+			ec.mtx.Unlock()
+			cancel()
+
+			if err != nil {
+				consecutiveFailures++
+				level.Warn(ec.logger).Log("msg", "Etcd watch health probe failed",
+					"consecutiveFailures", consecutiveFailures, "err", err)
+				if consecutiveFailures >= EtcdWatchMaxConsecutiveFailures {
+					ec.setWatchHealthy(false)
+					level.Error(ec.logger).Log("msg", "Etcd watch appears wedged, recreating")
+					cancelWatch()
+					return
+				}
+				continue
+			}
+
+			consecutiveFailures = 0
+			ec.setWatchHealthy(true)
+		}
 	}
+}
 
-	// Write to etcd if EndsAt's are "different" enough
-	significantTimeDifference := 300 * time.Second
-	if (a.EndsAt.Before(o.EndsAt) && o.EndsAt.Sub(a.EndsAt) > significantTimeDifference) || (o.EndsAt.Before(a.EndsAt) && a.EndsAt.Sub(o.EndsAt) > significantTimeDifference) {
-		// Update because EndsAt is different enough
-		return true
+func (ec *EtcdClient) setWatchHealthy(healthy bool) {
+	if healthy {
+		ec.healthMtx.Lock()
+		ec.lastHealthyTime = time.Now()
+		ec.healthMtx.Unlock()
+		etcdWatchHealthy.Set(1)
+	} else {
+		etcdWatchHealthy.Set(0)
 	}
+}
 
-	// we explicitly ignore UpdatedAt
-	// if !a.UpdatedAt.Equal(o.UpdatedAt) {
-	// 	return true
-	// }
-	return a.Timeout != o.Timeout
+// LastHealthyTime returns the last time the watch health probe succeeded.
+func (ec *EtcdClient) LastHealthyTime() time.Time {
+	ec.healthMtx.Lock()
+	defer ec.healthMtx.Unlock()
+	return ec.lastHealthyTime
 }
 
-func MarshalAlert(alert *types.Alert) (string, error) {
-	b, err := json.Marshal(alert)
-	if err != nil {
-		return "", err
+func (ec *EtcdClient) LoadAll(ctx context.Context) {
+	go func() {
+		if _, err := ec.ensureLoaded(ctx); err != nil {
+			level.Error(ec.logger).Log("msg", "Giving up loading all alerts from etcd", "err", err)
+		}
+	}()
+}
+
+// ensureLoaded runs the initial loadAllWithRetry exactly once: the first
+// caller (LoadAll or runWatch, whichever runs first) performs the load,
+// and any concurrent or later caller blocks on that same result instead of
+// loading every alert again.
+func (ec *EtcdClient) ensureLoaded(ctx context.Context) (int64, error) {
+	ec.loadOnce.Do(func() {
+		ec.loadRev, ec.loadErr = ec.loadAllWithRetry(ctx)
+	})
+	return ec.loadRev, ec.loadErr
+}
+
+// loadAllWithRetry retries loadAllOnce, with a delay of EtcdRetryGetFailure
+// between attempts, until it succeeds or ctx is done.
+func (ec *EtcdClient) loadAllWithRetry(ctx context.Context) (int64, error) {
+	for {
+		rev, err := ec.loadAllOnce(ctx)
+		if err == nil {
+			return rev, nil
+		}
+		level.Error(ec.logger).Log("msg", "Error fetching all alerts etcd", "err", err)
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(EtcdRetryGetFailure):
+		}
 	}
-	return string(b), nil
 }
 
-func UnmarshalAlert(alertStr string) (*types.Alert, error) {
-	var alert types.Alert
-	err := json.Unmarshal([]byte(alertStr), &alert)
+// loadAllOnce loads every alert currently under alertKeyPrefix into local
+// memory and returns the etcd revision the snapshot was read at, so callers
+// (namely Watch, after a compaction) can pick up from exactly that point.
+func (ec *EtcdClient) loadAllOnce(ctx context.Context) (int64, error) {
+	ec.mtx.Lock()
+	resp, err := ec.client.Get(ctx, alertKeyPrefix, clientv3.WithPrefix())
+	ec.mtx.Unlock()
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+
+	count := 0
+	for _, ev := range resp.Kvs {
+		level.Debug(ec.logger).Log("msg", "get received",
+			"key", fmt.Sprintf("%q", ev.Key), "value", fmt.Sprintf("%q", ev.Value))
+		alert, err := kvstore.UnmarshalAlert(string(ev.Value))
+		if err != nil {
+			continue
+		}
+		count += 1
+		_ = ec.alerts.PutFromEtcd(alert) // best effort only
 	}
-	return &alert, nil
+	level.Info(ec.logger).Log("msg", "Etcd Load All Alerts Finished", "count", count, "revision", resp.Header.Revision)
+	return resp.Header.Revision, nil
 }
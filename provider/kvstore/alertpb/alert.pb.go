@@ -0,0 +1,26 @@
+// Package alertpb is hand-maintained, not protoc-generated: this build has
+// no protoc available. It mirrors the proto3 schema in alert.proto closely
+// enough to round-trip through golang/protobuf's proto.Marshal/Unmarshal
+// (struct tags match what protoc-gen-go would emit); keep it in sync by hand
+// whenever alert.proto changes.
+package alertpb
+
+import (
+	proto "github.com/golang/protobuf/proto"
+)
+
+// Alert mirrors github.com/prometheus/alertmanager/types.Alert, trimmed to
+// the fields that need to round-trip through the backend kvstore.
+type Alert struct {
+	Labels            map[string]string `protobuf:"bytes,1,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Annotations       map[string]string `protobuf:"bytes,2,rep,name=annotations,proto3" json:"annotations,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	StartsAtUnixNano  int64             `protobuf:"varint,3,opt,name=starts_at_unix_nano,json=startsAtUnixNano,proto3" json:"starts_at_unix_nano,omitempty"`
+	EndsAtUnixNano    int64             `protobuf:"varint,4,opt,name=ends_at_unix_nano,json=endsAtUnixNano,proto3" json:"ends_at_unix_nano,omitempty"`
+	GeneratorURL      string            `protobuf:"bytes,5,opt,name=generator_url,json=generatorUrl,proto3" json:"generator_url,omitempty"`
+	UpdatedAtUnixNano int64             `protobuf:"varint,6,opt,name=updated_at_unix_nano,json=updatedAtUnixNano,proto3" json:"updated_at_unix_nano,omitempty"`
+	Timeout           bool              `protobuf:"varint,7,opt,name=timeout,proto3" json:"timeout,omitempty"`
+}
+
+func (m *Alert) Reset()         { *m = Alert{} }
+func (m *Alert) String() string { return proto.CompactTextString(m) }
+func (*Alert) ProtoMessage()    {}
@@ -0,0 +1,210 @@
+// Copyright 2019 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/alertmanager/types"
+
+	"github.com/neermitt/alertmanager-ha/provider/kvstore/alertpb"
+)
+
+// CodecKind identifies a wire format for alert values, selectable via
+// --cluster.etcd.codec.
+type CodecKind string
+
+const (
+	CodecJSON        CodecKind = "json"
+	CodecProto       CodecKind = "proto"
+	CodecProtoSnappy CodecKind = "proto+snappy"
+)
+
+// Codec serializes alerts for storage in a backend store. Every
+// implementation except legacyJSONCodec prefixes its output with a one-byte
+// magic/version marker so UnmarshalAlert can dispatch to the right decoder
+// no matter which Codec the peer that wrote the value had configured;
+// legacyJSONCodec writes no prefix at all, matching the bare JSON format
+// every instance spoke before codecs existed, so it stays the default and a
+// rolling upgrade never hands an old, magic-byte-unaware peer a value it
+// can't read.
+type Codec interface {
+	Marshal(alert *types.Alert) (string, error)
+}
+
+const (
+	magicJSON        byte = 0x01
+	magicProto       byte = 0x02
+	magicProtoSnappy byte = 0x03
+)
+
+// NewCodec returns the Codec implementation selected by kind. An empty kind
+// (--cluster.etcd.codec left unset) selects legacyJSONCodec, the bare,
+// unprefixed json.Marshal format every instance spoke before codecs existed:
+// a magic-prefixed value written by an upgraded peer would otherwise be
+// unreadable by an old peer's bare json.Unmarshal mid-rollout, silently
+// dropping alerts on a rolling upgrade. Only an explicit CodecJSON selection
+// opts in to the magic-prefixed jsonCodec.
+func NewCodec(kind CodecKind) (Codec, error) {
+	switch kind {
+	case "":
+		return legacyJSONCodec{}, nil
+	case CodecJSON:
+		return jsonCodec{}, nil
+	case CodecProto:
+		return protoCodec{}, nil
+	case CodecProtoSnappy:
+		return protoCodec{snappy: true}, nil
+	default:
+		return nil, fmt.Errorf("kvstore: unknown codec %q", kind)
+	}
+}
+
+// legacyJSONCodec writes bare, unprefixed JSON, matching every instance's
+// on-the-wire format before codecs existed. UnmarshalAlert's no-magic-prefix
+// fallback path reads it back.
+type legacyJSONCodec struct{}
+
+func (legacyJSONCodec) Marshal(alert *types.Alert) (string, error) {
+	b, err := json.Marshal(alert)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(alert *types.Alert) (string, error) {
+	b, err := json.Marshal(alert)
+	if err != nil {
+		return "", err
+	}
+	return string(append([]byte{magicJSON}, b...)), nil
+}
+
+type protoCodec struct {
+	snappy bool
+}
+
+func (c protoCodec) Marshal(alert *types.Alert) (string, error) {
+	b, err := proto.Marshal(toProto(alert))
+	if err != nil {
+		return "", err
+	}
+
+	magic := magicProto
+	if c.snappy {
+		b = snappy.Encode(nil, b)
+		magic = magicProtoSnappy
+	}
+	return string(append([]byte{magic}, b...)), nil
+}
+
+// UnmarshalAlert deserializes an alert previously written by any Codec,
+// dispatching on the one-byte magic prefix so a mixed-codec cluster (e.g.
+// mid-rollout) can still read every peer's writes regardless of which Codec
+// this instance is itself configured to write with.
+func UnmarshalAlert(data string) (*types.Alert, error) {
+	if len(data) == 0 {
+		return nil, errors.New("kvstore: empty alert value")
+	}
+
+	magic, payload := data[0], []byte(data[1:])
+	switch magic {
+	case magicProto:
+		return fromProtoBytes(payload)
+	case magicProtoSnappy:
+		decoded, err := snappy.Decode(nil, payload)
+		if err != nil {
+			return nil, err
+		}
+		return fromProtoBytes(decoded)
+	case magicJSON:
+		return unmarshalJSON(payload)
+	default:
+		// Values written before codecs existed have no magic prefix at all;
+		// treat the whole value, including the byte we just read as a
+		// magic marker, as raw JSON.
+		return unmarshalJSON([]byte(data))
+	}
+}
+
+func unmarshalJSON(payload []byte) (*types.Alert, error) {
+	var alert types.Alert
+	if err := json.Unmarshal(payload, &alert); err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+func fromProtoBytes(payload []byte) (*types.Alert, error) {
+	var pb alertpb.Alert
+	if err := proto.Unmarshal(payload, &pb); err != nil {
+		return nil, err
+	}
+	return fromProto(&pb), nil
+}
+
+func toProto(alert *types.Alert) *alertpb.Alert {
+	labels := make(map[string]string, len(alert.Labels))
+	for k, v := range alert.Labels {
+		labels[string(k)] = string(v)
+	}
+	annotations := make(map[string]string, len(alert.Annotations))
+	for k, v := range alert.Annotations {
+		annotations[string(k)] = string(v)
+	}
+
+	return &alertpb.Alert{
+		Labels:            labels,
+		Annotations:       annotations,
+		StartsAtUnixNano:  alert.StartsAt.UnixNano(),
+		EndsAtUnixNano:    alert.EndsAt.UnixNano(),
+		GeneratorURL:      alert.GeneratorURL,
+		UpdatedAtUnixNano: alert.UpdatedAt.UnixNano(),
+		Timeout:           alert.Timeout,
+	}
+}
+
+func fromProto(pb *alertpb.Alert) *types.Alert {
+	labels := make(model.LabelSet, len(pb.Labels))
+	for k, v := range pb.Labels {
+		labels[model.LabelName(k)] = model.LabelValue(v)
+	}
+	annotations := make(model.LabelSet, len(pb.Annotations))
+	for k, v := range pb.Annotations {
+		annotations[model.LabelName(k)] = model.LabelValue(v)
+	}
+
+	return &types.Alert{
+		Alert: model.Alert{
+			Labels:       labels,
+			Annotations:  annotations,
+			StartsAt:     time.Unix(0, pb.StartsAtUnixNano).UTC(),
+			EndsAt:       time.Unix(0, pb.EndsAtUnixNano).UTC(),
+			GeneratorURL: pb.GeneratorURL,
+		},
+		UpdatedAt: time.Unix(0, pb.UpdatedAtUnixNano).UTC(),
+		Timeout:   pb.Timeout,
+	}
+}
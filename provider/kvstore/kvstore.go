@@ -0,0 +1,99 @@
+// Copyright 2019 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kvstore defines the backend-agnostic abstraction used to replicate
+// Alertmanager's in-memory alert state across HA peers. Concrete backends
+// (etcd, consul, ...) implement Provider, and the cluster is wired to
+// whichever one the operator selects via --cluster.store.
+package kvstore
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/alertmanager/types"
+)
+
+// Backend identifies a kvstore.Provider implementation selectable via
+// --cluster.store.
+type Backend string
+
+const (
+	Etcd   Backend = "etcd"
+	Consul Backend = "consul"
+)
+
+// Provider is implemented by every supported alert-state backend store.
+type Provider interface {
+	// Get returns the alert currently stored for fp.
+	Get(fp model.Fingerprint) (*types.Alert, error)
+	// Put writes alert to the store, unconditionally.
+	Put(alert *types.Alert) error
+	// Del removes the alert stored for fp.
+	Del(fp model.Fingerprint) error
+	// CheckAndPut writes alert to the store only if it differs enough from
+	// oldAlert to be worth replicating; see ShouldWriteAlert.
+	CheckAndPut(oldAlert *types.Alert, alert *types.Alert) error
+	// LoadAll loads every alert currently held by the store into local
+	// memory. It is called once at startup to seed this instance's state
+	// from its peers.
+	LoadAll(ctx context.Context)
+	// Watch watches the store for changes made by other cluster peers and
+	// applies them to local memory as they arrive.
+	Watch(ctx context.Context)
+}
+
+// AlertSink is the subset of Alertmanager's in-memory alert store that a
+// Provider needs in order to apply alerts observed from the backend store
+// into local memory.
+type AlertSink interface {
+	PutFromEtcd(alert *types.Alert) error
+}
+
+// significantTimeDifference is the EndsAt skew above which two otherwise
+// identical alerts are still considered different enough to replicate.
+const significantTimeDifference = 300 * time.Second
+
+// ShouldWriteAlert reports whether alert differs enough from oldAlert to be
+// worth writing to the backend store. It is used by every Provider's
+// CheckAndPut to avoid replicating writes that wouldn't change anything a
+// peer cares about.
+func ShouldWriteAlert(oldAlert, alert *types.Alert) bool {
+	if oldAlert == nil || alert == nil {
+		return true
+	}
+	if !reflect.DeepEqual(alert.Labels, oldAlert.Labels) {
+		return true
+	}
+	if !reflect.DeepEqual(alert.Annotations, oldAlert.Annotations) {
+		return true
+	}
+	if alert.GeneratorURL != oldAlert.GeneratorURL {
+		return true
+	}
+	if !alert.StartsAt.Equal(oldAlert.StartsAt) {
+		return true
+	}
+
+	// Write if EndsAt's are "different" enough.
+	if (alert.EndsAt.Before(oldAlert.EndsAt) && oldAlert.EndsAt.Sub(alert.EndsAt) > significantTimeDifference) ||
+		(oldAlert.EndsAt.Before(alert.EndsAt) && alert.EndsAt.Sub(oldAlert.EndsAt) > significantTimeDifference) {
+		return true
+	}
+
+	// we explicitly ignore UpdatedAt
+	return alert.Timeout != oldAlert.Timeout
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/alertmanager/types"
+)
+
+func baseAlert() *types.Alert {
+	return &types.Alert{
+		Alert: model.Alert{
+			Labels:       model.LabelSet{"alertname": "Test"},
+			Annotations:  model.LabelSet{"summary": "a test alert"},
+			StartsAt:     time.Unix(1000, 0).UTC(),
+			EndsAt:       time.Unix(2000, 0).UTC(),
+			GeneratorURL: "http://example.com/graph",
+		},
+		UpdatedAt: time.Unix(1500, 0).UTC(),
+		Timeout:   false,
+	}
+}
+
+func TestShouldWriteAlert(t *testing.T) {
+	cases := []struct {
+		name     string
+		oldAlert *types.Alert
+		alert    func(*types.Alert)
+		want     bool
+	}{
+		{
+			name:     "nil oldAlert",
+			oldAlert: nil,
+			alert:    func(a *types.Alert) {},
+			want:     true,
+		},
+		{
+			name:     "identical",
+			oldAlert: baseAlert(),
+			alert:    func(a *types.Alert) {},
+			want:     false,
+		},
+		{
+			name:     "labels changed",
+			oldAlert: baseAlert(),
+			alert: func(a *types.Alert) {
+				a.Labels["severity"] = "critical"
+			},
+			want: true,
+		},
+		{
+			name:     "annotations changed",
+			oldAlert: baseAlert(),
+			alert: func(a *types.Alert) {
+				a.Annotations["summary"] = "a different summary"
+			},
+			want: true,
+		},
+		{
+			name:     "generator URL changed",
+			oldAlert: baseAlert(),
+			alert: func(a *types.Alert) {
+				a.GeneratorURL = "http://example.com/other"
+			},
+			want: true,
+		},
+		{
+			name:     "startsAt changed",
+			oldAlert: baseAlert(),
+			alert: func(a *types.Alert) {
+				a.StartsAt = a.StartsAt.Add(time.Second)
+			},
+			want: true,
+		},
+		{
+			name:     "endsAt shifted insignificantly",
+			oldAlert: baseAlert(),
+			alert: func(a *types.Alert) {
+				a.EndsAt = a.EndsAt.Add(significantTimeDifference - time.Second)
+			},
+			want: false,
+		},
+		{
+			name:     "endsAt shifted significantly later",
+			oldAlert: baseAlert(),
+			alert: func(a *types.Alert) {
+				a.EndsAt = a.EndsAt.Add(significantTimeDifference + time.Second)
+			},
+			want: true,
+		},
+		{
+			name:     "endsAt shifted significantly earlier",
+			oldAlert: baseAlert(),
+			alert: func(a *types.Alert) {
+				a.EndsAt = a.EndsAt.Add(-(significantTimeDifference + time.Second))
+			},
+			want: true,
+		},
+		{
+			name:     "timeout changed",
+			oldAlert: baseAlert(),
+			alert: func(a *types.Alert) {
+				a.Timeout = true
+			},
+			want: true,
+		},
+		{
+			name:     "updatedAt changed only",
+			oldAlert: baseAlert(),
+			alert: func(a *types.Alert) {
+				a.UpdatedAt = a.UpdatedAt.Add(time.Hour)
+			},
+			want: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			alert := baseAlert()
+			c.alert(alert)
+
+			got := ShouldWriteAlert(c.oldAlert, alert)
+			if got != c.want {
+				t.Errorf("ShouldWriteAlert() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package provider selects and constructs the kvstore.Provider implementation
+// chosen via --cluster.store. It lives above both backend packages (rather
+// than in kvstore itself) since kvstore is imported by etcd and consul, and
+// a factory dispatching to either would otherwise create an import cycle.
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/neermitt/alertmanager-ha/provider/consul"
+	"github.com/neermitt/alertmanager-ha/provider/etcd"
+	"github.com/neermitt/alertmanager-ha/provider/kvstore"
+)
+
+// New constructs the kvstore.Provider selected by backend. Only the Config
+// matching backend is used; the other is ignored.
+func New(ctx context.Context, backend kvstore.Backend, alerts kvstore.AlertSink, logger log.Logger, etcdCfg etcd.Config, consulCfg consul.Config) (kvstore.Provider, error) {
+	switch backend {
+	case kvstore.Etcd:
+		return etcd.NewEtcdClient(ctx, alerts, logger, etcdCfg)
+	case kvstore.Consul:
+		return consul.NewConsulClient(ctx, alerts, logger, consulCfg)
+	default:
+		return nil, fmt.Errorf("provider: unknown backend %q", backend)
+	}
+}